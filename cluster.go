@@ -0,0 +1,115 @@
+package harmonic
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ClusterState holds the list of services in a cluster, their current
+// error counts, and the synchronization primitives required to select
+// a service in a thread-safe manner. A ClusterState is created once per
+// cluster via InitClusterState and shared across all callers of
+// SelectService.
+type ClusterState struct {
+	servicelist []string
+	numservices int
+	errormap    map[string]uint64
+	remutex     sync.RWMutex
+
+	// Mode records which entry point of the SelectService family routes this
+	// cluster. Defaults to ModeWeightedRandom. SelectService returns an error
+	// under ModeRendezvousHash; SelectServiceForKey does not read Mode.
+	Mode SelectionMode
+
+	// Hash64 is the hash function used by SelectServiceForKey to score
+	// services against a key. If nil, fnv1a64 is used. Callers may swap
+	// in a different 64-bit hash (e.g. xxhash) for better distribution.
+	Hash64 func(string) uint64
+
+	// ejectionMu guards ejectionCfg/ejections. Kept separate from remutex
+	// so outlier bookkeeping never holds remutex. SelectService still takes
+	// ejectionMu on every call with more than one service (via
+	// forcedHalfOpenProbe and eligibleServices).
+	ejectionMu  sync.Mutex
+	ejectionCfg EjectionConfig
+	ejections   map[string]*ejectionRecord
+
+	// Observer receives callbacks at each selection/error-bookkeeping
+	// decision point. Defaults to NoopObserver; set to a custom Observer
+	// (e.g. the prometheus subpackage's PrometheusObserver) to wire up
+	// metrics, tracing or logging.
+	Observer Observer
+
+	// Strategy controls how SelectService picks a starting point among
+	// equally-eligible candidates on the first try. Defaults to
+	// StrategyRandom for backward compatibility.
+	Strategy SelectionStrategy
+
+	// startIndex backs StrategyAtomicRR/StrategyHybrid; see nextStartIndex.
+	startIndex atomic.Int32
+}
+
+// InitClusterState initializes a new ClusterState from a flat list of
+// service endpoints. An error is returned if the servicelist is empty.
+func InitClusterState(servicelist []string) (*ClusterState, error) {
+
+	if len(servicelist) == 0 {
+		return nil, errors.New("harmonic: servicelist cannot be empty")
+	}
+
+	return &ClusterState{
+		servicelist: servicelist,
+		numservices: len(servicelist),
+		errormap:    make(map[string]uint64),
+		Observer:    NoopObserver{},
+	}, nil
+}
+
+// IncrementError increments the error count tracked against a service by one.
+func (cs *ClusterState) IncrementError(svc string) {
+
+	cs.remutex.Lock()
+	cs.errormap[svc]++
+	count := cs.errormap[svc]
+	cs.remutex.Unlock()
+
+	cs.recordErrorForEjection(svc)
+	cs.observer().OnErrorIncrement(svc, count)
+}
+
+// ResetError resets the error count tracked against a service back to zero.
+func (cs *ClusterState) ResetError(svc string) {
+
+	cs.remutex.Lock()
+	cs.errormap[svc] = 0
+	cs.remutex.Unlock()
+
+	cs.recordResetForEjection(svc)
+	cs.observer().OnReset(svc)
+}
+
+// observer returns cs.Observer, falling back to NoopObserver for a
+// ClusterState constructed without going through InitClusterState.
+func (cs *ClusterState) observer() Observer {
+
+	if cs.Observer == nil {
+		return NoopObserver{}
+	}
+
+	return cs.Observer
+}
+
+// GetError returns the current error count tracked against a service.
+func (cs *ClusterState) GetError(svc string) (uint64, error) {
+
+	cs.remutex.RLock()
+	defer cs.remutex.RUnlock()
+
+	errcnt, ok := cs.errormap[svc]
+	if !ok {
+		return 0, errors.New("harmonic: service not found")
+	}
+
+	return errcnt, nil
+}
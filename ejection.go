@@ -0,0 +1,241 @@
+package harmonic
+
+import (
+	"time"
+)
+
+// EjectionConfig configures the outlier detector installed by
+// ClusterState.ConfigureEjection. A zero-value EjectionConfig (the default
+// for every ClusterState) disables ejection entirely: SelectService falls
+// back to weighting every service, as before.
+type EjectionConfig struct {
+	// ConsecutiveErrors is the number of errors a service must accumulate
+	// within Window before it is ejected. Zero disables ejection.
+	ConsecutiveErrors uint64
+	// Window is the duration over which ConsecutiveErrors is counted. The
+	// window is fixed, not sliding: it opens at an error recorded after the
+	// previous window expired, and all of its errors are dropped together
+	// once Window has passed since it opened.
+	Window time.Duration
+	// BaseEjectionTime is the backoff applied the first time a service is
+	// ejected. Each subsequent ejection of the same service doubles the
+	// previous backoff.
+	BaseEjectionTime time.Duration
+	// MaxEjectionPercent caps the fraction (0.0-1.0) of the cluster that may
+	// be actively ejected at once; once hit, further outliers are left
+	// in the candidate list (merely down-weighted) rather than ejected.
+	MaxEjectionPercent float64
+}
+
+// ejectionRecord tracks the fixed error window and ejection/half-open
+// state for a single service.
+type ejectionRecord struct {
+	windowStart  time.Time
+	windowErrors uint64
+
+	ejected           bool
+	ejectedUntil      time.Time
+	ejectCount        int
+	halfOpenProbeSent bool
+}
+
+// EjectionStat is a point-in-time snapshot of one service's outlier state,
+// returned by ClusterState.EjectionStats.
+type EjectionStat struct {
+	Ejected      bool
+	EjectCount   int
+	EjectedUntil time.Time
+}
+
+// ConfigureEjection installs (or disables, via a zero-value cfg) the
+// outlier detector for cs. It must be called before SelectService is used
+// concurrently with it.
+func (cs *ClusterState) ConfigureEjection(cfg EjectionConfig) {
+
+	cs.ejectionMu.Lock()
+	defer cs.ejectionMu.Unlock()
+
+	cs.ejectionCfg = cfg
+	cs.ejections = make(map[string]*ejectionRecord)
+}
+
+// EjectionStats returns a snapshot of the current ejection state of every
+// service that has ever recorded an error.
+func (cs *ClusterState) EjectionStats() map[string]EjectionStat {
+
+	cs.ejectionMu.Lock()
+	defer cs.ejectionMu.Unlock()
+
+	stats := make(map[string]EjectionStat, len(cs.ejections))
+	for svc, rec := range cs.ejections {
+		stats[svc] = EjectionStat{
+			Ejected:      rec.ejected,
+			EjectCount:   rec.ejectCount,
+			EjectedUntil: rec.ejectedUntil,
+		}
+	}
+
+	return stats
+}
+
+// recordErrorForEjection folds one IncrementError call into svc's fixed
+// error window (see EjectionConfig.Window) and, once ConsecutiveErrors is crossed within Window,
+// ejects the service. A failure of the single probe request routed to a
+// half-open (backoff-expired) service re-ejects it with a longer backoff.
+func (cs *ClusterState) recordErrorForEjection(svc string) {
+
+	cs.ejectionMu.Lock()
+	defer cs.ejectionMu.Unlock()
+
+	if cs.ejectionCfg.ConsecutiveErrors == 0 {
+		return
+	}
+
+	rec := cs.ejectionRecord(svc)
+	now := time.Now()
+
+	if rec.halfOpenProbeSent {
+		// the one probe we let through failed; re-eject with a longer backoff
+		cs.ejectService(rec, now)
+		return
+	}
+
+	if now.After(rec.windowStart.Add(cs.ejectionCfg.Window)) {
+		rec.windowStart = now
+		rec.windowErrors = 0
+	}
+	rec.windowErrors++
+
+	if !rec.ejected && rec.windowErrors >= cs.ejectionCfg.ConsecutiveErrors && cs.ejectionBudgetAvailableLocked() {
+		cs.ejectService(rec, now)
+	}
+}
+
+// recordResetForEjection clears ejection state for svc on a successful
+// outcome (a caller calling ResetError), exactly as a half-open probe
+// succeeding clears ejection in a standard outlier detector.
+func (cs *ClusterState) recordResetForEjection(svc string) {
+
+	cs.ejectionMu.Lock()
+	defer cs.ejectionMu.Unlock()
+
+	if cs.ejectionCfg.ConsecutiveErrors == 0 {
+		return
+	}
+
+	rec, ok := cs.ejections[svc]
+	if !ok {
+		return
+	}
+
+	rec.ejected = false
+	rec.ejectCount = 0
+	rec.windowErrors = 0
+	rec.halfOpenProbeSent = false
+}
+
+// ejectService marks rec ejected with an exponentially grown backoff.
+// Caller must hold cs.ejectionMu.
+func (cs *ClusterState) ejectService(rec *ejectionRecord, now time.Time) {
+
+	rec.ejected = true
+	rec.ejectCount++
+	rec.halfOpenProbeSent = false
+	rec.windowErrors = 0
+
+	backoff := cs.ejectionCfg.BaseEjectionTime << uint(rec.ejectCount-1)
+	rec.ejectedUntil = now.Add(backoff)
+}
+
+// ejectionBudgetAvailableLocked reports whether another service can be
+// ejected without exceeding MaxEjectionPercent of the cluster. Caller must
+// hold cs.ejectionMu.
+func (cs *ClusterState) ejectionBudgetAvailableLocked() bool {
+
+	if cs.ejectionCfg.MaxEjectionPercent <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	ejected := 0
+	for _, rec := range cs.ejections {
+		if rec.ejected && now.Before(rec.ejectedUntil) {
+			ejected++
+		}
+	}
+
+	return float64(ejected+1)/float64(cs.numservices) <= cs.ejectionCfg.MaxEjectionPercent
+}
+
+// ejectionRecord returns (creating if necessary) the record for svc. Caller
+// must hold cs.ejectionMu.
+func (cs *ClusterState) ejectionRecord(svc string) *ejectionRecord {
+
+	rec, ok := cs.ejections[svc]
+	if !ok {
+		rec = &ejectionRecord{windowStart: time.Now()}
+		cs.ejections[svc] = rec
+	}
+
+	return rec
+}
+
+// eligibleServices returns cs.servicelist with every actively-ejected
+// service removed, including one whose backoff has expired but whose
+// half-open probe hasn't been claimed yet - that claim, and the single
+// probe request it grants, is handled separately by forcedHalfOpenProbe so
+// it can be routed deterministically rather than left to weighted-random
+// selection (which, given the service's still-high error count, would
+// rarely if ever actually pick it).
+func (cs *ClusterState) eligibleServices() []string {
+
+	cs.ejectionMu.Lock()
+	defer cs.ejectionMu.Unlock()
+
+	if cs.ejectionCfg.ConsecutiveErrors == 0 || len(cs.ejections) == 0 {
+		return cs.servicelist
+	}
+
+	candidates := make([]string, 0, cs.numservices)
+
+	for _, svc := range cs.servicelist {
+		rec, ok := cs.ejections[svc]
+		if !ok || !rec.ejected {
+			candidates = append(candidates, svc)
+		}
+	}
+
+	return candidates
+}
+
+// forcedHalfOpenProbe claims (and returns) the one ejected service, if any,
+// whose backoff has expired and which hasn't already been routed a probe.
+// Claiming sets halfOpenProbeSent so no other caller is handed the same
+// probe, and so the eventual IncrementError/ResetError call the caller
+// makes against the returned service is the one that clears or re-extends
+// its ejection - see recordErrorForEjection/recordResetForEjection.
+func (cs *ClusterState) forcedHalfOpenProbe() (string, bool) {
+
+	cs.ejectionMu.Lock()
+	defer cs.ejectionMu.Unlock()
+
+	if cs.ejectionCfg.ConsecutiveErrors == 0 || len(cs.ejections) == 0 {
+		return "", false
+	}
+
+	now := time.Now()
+
+	for _, svc := range cs.servicelist {
+		rec, ok := cs.ejections[svc]
+		if !ok || !rec.ejected || rec.halfOpenProbeSent {
+			continue
+		}
+
+		if now.After(rec.ejectedUntil) {
+			rec.halfOpenProbeSent = true
+			return svc, true
+		}
+	}
+
+	return "", false
+}
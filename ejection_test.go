@@ -0,0 +1,149 @@
+package harmonic
+
+import (
+	"testing"
+	"time"
+)
+
+// recordingObserver captures every SelectReason seen by OnSelect, keyed by
+// service, for assertions. All other callbacks are no-ops.
+type recordingObserver struct {
+	reasons map[string][]SelectReason
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{reasons: make(map[string][]SelectReason)}
+}
+
+func (r *recordingObserver) OnSelect(svc string, reason SelectReason, weights []float64) {
+	r.reasons[svc] = append(r.reasons[svc], reason)
+}
+func (r *recordingObserver) OnRetry(prev string, next string, attempt int) {}
+func (r *recordingObserver) OnErrorIncrement(svc string, count uint64)     {}
+func (r *recordingObserver) OnReset(svc string)                            {}
+
+// TestEjectionHalfOpenRecovery reproduces the scenario from the chunk0-3
+// review: an ejected service must be routed its single half-open probe once
+// its backoff expires, and a successful probe must make it eligible again -
+// not permanently excluded regardless of what SelectService's weighting
+// would otherwise have chosen.
+func TestEjectionHalfOpenRecovery(t *testing.T) {
+
+	cs, err := InitClusterState([]string{"svcA", "svcB"})
+	if err != nil {
+		t.Fatalf("InitClusterState: %v", err)
+	}
+
+	obs := newRecordingObserver()
+	cs.Observer = obs
+
+	cs.ConfigureEjection(EjectionConfig{
+		ConsecutiveErrors: 1,
+		Window:            time.Hour,
+		BaseEjectionTime:  20 * time.Millisecond,
+	})
+
+	cs.IncrementError("svcA")
+
+	stats := cs.EjectionStats()
+	if !stats["svcA"].Ejected {
+		t.Fatalf("expected svcA to be ejected, got %+v", stats["svcA"])
+	}
+
+	// Before backoff expires, svcA must never be selected.
+	for i := 0; i < 10; i++ {
+		svc, err := SelectService(cs, 0, "")
+		if err != nil {
+			t.Fatalf("SelectService: %v", err)
+		}
+		if svc != "svcB" {
+			t.Fatalf("expected svcB while svcA is ejected and not yet half-open, got %s", svc)
+		}
+	}
+
+	time.Sleep(25 * time.Millisecond)
+
+	svc, err := SelectService(cs, 0, "")
+	if err != nil {
+		t.Fatalf("SelectService: %v", err)
+	}
+	if svc != "svcA" {
+		t.Fatalf("expected svcA to be force-selected for its half-open probe, got %s", svc)
+	}
+	if got := obs.reasons["svcA"][len(obs.reasons["svcA"])-1]; got != ReasonHalfOpenProbe {
+		t.Fatalf("expected ReasonHalfOpenProbe, got %s", got)
+	}
+
+	// Until the probe's outcome is reported, svcA must not be handed out
+	// again (the single in-flight probe hasn't resolved).
+	for i := 0; i < 5; i++ {
+		svc, err := SelectService(cs, 0, "")
+		if err != nil {
+			t.Fatalf("SelectService: %v", err)
+		}
+		if svc != "svcB" {
+			t.Fatalf("expected svcB while svcA's half-open probe is outstanding, got %s", svc)
+		}
+	}
+
+	// The probe succeeds: svcA must become eligible again.
+	cs.ResetError("svcA")
+
+	if stats := cs.EjectionStats(); stats["svcA"].Ejected {
+		t.Fatalf("expected svcA to no longer be ejected after a successful probe, got %+v", stats["svcA"])
+	}
+
+	seenA := false
+	for i := 0; i < 20; i++ {
+		svc, err := SelectService(cs, 0, "")
+		if err != nil {
+			t.Fatalf("SelectService: %v", err)
+		}
+		if svc == "svcA" {
+			seenA = true
+			break
+		}
+	}
+	if !seenA {
+		t.Fatalf("expected svcA to be selectable again after recovery, but it never was across 20 tries")
+	}
+}
+
+// TestEjectionHalfOpenProbeFailureReEjects verifies that a failed half-open
+// probe re-ejects the service with a longer backoff, rather than leaving it
+// permanently half-open or permanently eligible.
+func TestEjectionHalfOpenProbeFailureReEjects(t *testing.T) {
+
+	cs, err := InitClusterState([]string{"svcA", "svcB"})
+	if err != nil {
+		t.Fatalf("InitClusterState: %v", err)
+	}
+
+	cs.ConfigureEjection(EjectionConfig{
+		ConsecutiveErrors: 1,
+		Window:            time.Hour,
+		BaseEjectionTime:  10 * time.Millisecond,
+	})
+
+	cs.IncrementError("svcA")
+	time.Sleep(15 * time.Millisecond)
+
+	svc, err := SelectService(cs, 0, "")
+	if err != nil {
+		t.Fatalf("SelectService: %v", err)
+	}
+	if svc != "svcA" {
+		t.Fatalf("expected svcA's half-open probe, got %s", svc)
+	}
+
+	// The probe fails: svcA re-ejects with a doubled backoff.
+	cs.IncrementError("svcA")
+
+	stats := cs.EjectionStats()
+	if !stats["svcA"].Ejected {
+		t.Fatalf("expected svcA to be re-ejected after its probe failed, got %+v", stats["svcA"])
+	}
+	if stats["svcA"].EjectCount != 2 {
+		t.Fatalf("expected EjectCount 2 after a second ejection, got %d", stats["svcA"].EjectCount)
+	}
+}
@@ -11,8 +11,22 @@ import (
 // is done, else weighted random service selection is done, where weights are inversely proportional
 // to error count on the particular service. If the request to the selected service fails, round robin
 // selection is done to deterministically select the next service.
+//
+// When ejection has been configured via ConfigureEjection, chronically erroring services are
+// excluded from the candidate list entirely (rather than merely down-weighted); the weight math
+// above is then applied only over the remaining, non-ejected services. See EjectionConfig. An
+// ejected service whose backoff has expired is instead force-selected on the first try, ahead of
+// the weighting above, so its single half-open probe request is actually routed to it rather than
+// left to chance.
+//
+// SelectService requires cs.Mode to be ModeWeightedRandom (the default); a ClusterState
+// configured with ModeRendezvousHash must be routed through SelectServiceForKey instead.
 func SelectService(cs *ClusterState, retryindex int, prevservice string) (string, error) {
 
+	if cs.Mode == ModeRendezvousHash {
+		return "", errors.New("harmonic: ClusterState is configured for ModeRendezvousHash; use SelectServiceForKey")
+	}
+
 	//invalid num of endpoints
 	if cs.numservices == 0 {
 		return "", errors.New("harmonic: servicelist is empty")
@@ -20,62 +34,126 @@ func SelectService(cs *ClusterState, retryindex int, prevservice string) (string
 
 	// single endpoint
 	if cs.numservices == 1 {
-		return getIndexedService(cs, 0)
+		svc, err := getIndexedService(cs, 0)
+		return cs.observeSelect(svc, err, ReasonSingleEndpoint, nil)
 	}
 
 	if retryindex == 0 { // first try
-		cs.remutex.Lock()
-		defer cs.remutex.Unlock()
+		if svc, ok := cs.forcedHalfOpenProbe(); ok {
+			return cs.observeSelect(svc, nil, ReasonHalfOpenProbe, nil)
+		}
+	}
 
-		maxerr := uint64(0)
+	candidates := cs.eligibleServices()
+	if len(candidates) == 0 {
+		// every service is ejected; fail open rather than lock out the cluster
+		candidates = cs.servicelist
+	}
+	ncandidates := len(candidates)
 
-		for _, svc := range cs.servicelist {
-			errcnt := cs.errormap[svc]
-			effectiveerr := uint64(math.Floor(math.Pow(float64(1+errcnt), 1.5)))
-			if effectiveerr >= maxerr {
-				maxerr = effectiveerr
+	if retryindex == 0 { // first try
+		svc, err, reason, weights := cs.selectFirstTry(candidates, ncandidates)
+		return cs.observeSelect(svc, err, reason, weights)
+	} else { // retries
+		prevserviceindex := -1
+		for psi, svc := range candidates {
+			if svc == prevservice {
+				prevserviceindex = psi
 			}
 		}
 
-		if maxerr == 1 {
-			return getIndexedService(cs, randomize(0, cs.numservices))
-		} else {
-			weights := make([]float64, cs.numservices)
-			prefixes := make([]float64, cs.numservices)
+		if prevserviceindex == -1 {
+			// prevservice is no longer a candidate (e.g. ejected since); restart
+			// from the front of the remaining candidates
+			svc, err := getIndexedFrom(candidates, 0)
+			cs.observer().OnRetry(prevservice, svc, retryindex)
+			return cs.observeSelect(svc, err, ReasonRetryRoundRobin, nil)
+		}
 
-			for i, svc := range cs.servicelist {
-				errcnt := cs.errormap[svc]
-				weights[i] = math.Ceil(float64(maxerr) / float64(errcnt+1))
-			}
+		svc, err := getIndexedFrom(candidates, roundrobin(ncandidates, prevserviceindex))
+		cs.observer().OnRetry(prevservice, svc, retryindex)
+		return cs.observeSelect(svc, err, ReasonRetryRoundRobin, nil)
+	}
+}
 
-			for i, _ := range weights {
-				if i == 0 {
-					prefixes[i] = weights[i]
-				} else {
-					prefixes[i] = weights[i] + prefixes[i-1]
-				}
-			}
+// selectFirstTry resolves which candidate to pick on a first try, weighting
+// inversely by error count. It returns the decision (and the reason/weights
+// behind it) without touching cs.Observer: the caller invokes observeSelect
+// itself once cs.remutex, held here, has been released, since an Observer
+// that re-enters ClusterState (e.g. calling GetError) would otherwise
+// deadlock against the non-reentrant remutex.
+func (cs *ClusterState) selectFirstTry(candidates []string, ncandidates int) (string, error, SelectReason, []float64) {
 
-			prlen := cs.numservices - 1
-			randx := randomize64(1, int64(prefixes[prlen])+1)
-			ceil := findCeilIn(randx, prefixes, 0, prlen)
+	cs.remutex.Lock()
+	defer cs.remutex.Unlock()
 
-			if ceil >= 0 {
-				return getIndexedService(cs, ceil)
-			}
+	maxerr := uint64(0)
+
+	for _, svc := range candidates {
+		errcnt := cs.errormap[svc]
+		effectiveerr := uint64(math.Floor(math.Pow(float64(1+errcnt), 1.5)))
+		if effectiveerr >= maxerr {
+			maxerr = effectiveerr
 		}
+	}
 
-		return getIndexedService(cs, randomize(0, cs.numservices))
-	} else { // retries
-		prevserviceindex := -1
-		for psi, svc := range cs.servicelist {
-			if svc == prevservice {
-				prevserviceindex = psi
-			}
+	if maxerr == 1 {
+		idx := randomize(0, ncandidates)
+		if cs.Strategy == StrategyAtomicRR || cs.Strategy == StrategyHybrid {
+			idx = cs.nextStartIndex(ncandidates)
 		}
 
-		return getIndexedService(cs, roundrobin(cs.numservices, prevserviceindex))
+		svc, err := getIndexedFrom(candidates, idx)
+		return svc, err, ReasonUniformRandom, nil
 	}
+
+	weights := make([]float64, ncandidates)
+	prefixes := make([]float64, ncandidates)
+
+	for i, svc := range candidates {
+		errcnt := cs.errormap[svc]
+		weights[i] = math.Ceil(float64(maxerr) / float64(errcnt+1))
+	}
+
+	for i, _ := range weights {
+		if i == 0 {
+			prefixes[i] = weights[i]
+		} else {
+			prefixes[i] = weights[i] + prefixes[i-1]
+		}
+	}
+
+	prlen := ncandidates - 1
+
+	var randx int64
+	if cs.Strategy == StrategyAtomicRR {
+		randx = cs.nextWeightedPos(int64(prefixes[prlen]))
+	} else {
+		randx = randomize64(1, int64(prefixes[prlen])+1)
+	}
+
+	ceil := findCeilIn(randx, prefixes, 0, prlen)
+
+	if ceil >= 0 {
+		svc, err := getIndexedFrom(candidates, ceil)
+		return svc, err, ReasonWeightedRandom, weights
+	}
+
+	svc, err := getIndexedFrom(candidates, randomize(0, ncandidates))
+	return svc, err, ReasonUniformRandom, nil
+}
+
+// observeSelect notifies cs.Observer.OnSelect when svc was successfully
+// resolved (err == nil), then returns (svc, err) unchanged. Centralizing
+// this here keeps SelectService's many return points from each having to
+// remember to fire the callback.
+func (cs *ClusterState) observeSelect(svc string, err error, reason SelectReason, weights []float64) (string, error) {
+
+	if err == nil {
+		cs.observer().OnSelect(svc, reason, weights)
+	}
+
+	return svc, err
 }
 
 // findCeilIn does a binary search to find position of selected random
@@ -111,3 +189,15 @@ func getIndexedService(cs *ClusterState, index int) (string, error) {
 
 	return cs.servicelist[index], nil
 }
+
+// getIndexedFrom returns the service at an index within an arbitrary
+// (e.g. ejection-filtered) candidate list. Error is returned if index is
+// found to be invalid.
+func getIndexedFrom(candidates []string, index int) (string, error) {
+
+	if index < 0 || index >= len(candidates) {
+		return "", errors.New("harmonic: service index out of bounds")
+	}
+
+	return candidates[index], nil
+}
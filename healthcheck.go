@@ -0,0 +1,165 @@
+package harmonic
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Probe is a user-supplied check run against a single service. A non-nil
+// error marks the probe as failed for that tick.
+type Probe func(ctx context.Context, svc string) error
+
+// HealthCheckConfig configures the background health-checking loop started
+// by ClusterState.StartHealthChecks.
+type HealthCheckConfig struct {
+	// Probe is invoked against every service on each tick.
+	Probe Probe
+	// Interval is the base time between ticks.
+	Interval time.Duration
+	// Jitter adds up to +/-Jitter of random skew to Interval, so that many
+	// ClusterStates started at the same time don't probe in lockstep.
+	Jitter time.Duration
+	// Concurrency bounds how many probes run in parallel per tick. Defaults
+	// to the number of services if left at zero.
+	Concurrency int
+	// ConsecutiveFailureThreshold is how many consecutive probe failures a
+	// service must accumulate before it is marked unhealthy (IncrementError
+	// is called). A single transient failure below this threshold does not
+	// affect SelectService's weighting.
+	ConsecutiveFailureThreshold int
+}
+
+// healthState tracks per-service probe history for one StartHealthChecks
+// loop.
+type healthState struct {
+	mu                  sync.Mutex
+	consecutivefailures map[string]int
+}
+
+// StartHealthChecks runs cfg.Probe against every service in cs on a
+// jittered interval, fanning the probes for a single tick out concurrently
+// (bounded by cfg.Concurrency) via errgroup.WithContext. Probe outcomes feed
+// back into cs via IncrementError/ResetError so SelectService reacts to
+// unhealthy services before real traffic hits them, turning the existing
+// passive error-count model into a hybrid passive+active one. It returns a
+// stop function that halts the background loop.
+func (cs *ClusterState) StartHealthChecks(cfg HealthCheckConfig) (stop func()) {
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = cs.numservices
+	}
+
+	state := &healthState{
+		consecutivefailures: make(map[string]int),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	jitter := cfg.Jitter
+	if jitter > cfg.Interval {
+		// Jitter may never exceed Interval: otherwise it could swing wait
+		// negative on its own, before the floor below even comes into play.
+		jitter = cfg.Interval
+	}
+
+	go func() {
+		for {
+			wait := cfg.Interval + jitterDuration(jitter)
+			if wait < minTickWait {
+				wait = minTickWait
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+				runHealthCheckTick(ctx, cs, cfg, state, concurrency)
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// minTickWait is the floor applied to the jittered tick interval, so a
+// misconfigured HealthCheckConfig (zero Interval, or Jitter >= Interval
+// producing a non-positive wait) can't spin the probe loop with no delay.
+const minTickWait = 10 * time.Millisecond
+
+// runHealthCheckTick probes every service in cs once, in parallel, bounded
+// by concurrency, and updates cs/state based on the outcomes.
+func runHealthCheckTick(ctx context.Context, cs *ClusterState, cfg HealthCheckConfig, state *healthState, concurrency int) {
+
+	g, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, concurrency)
+
+	for _, svc := range cs.servicelist {
+		svc := svc
+
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-sem }()
+
+			err := cfg.Probe(gctx, svc)
+			recordProbeResult(cs, cfg, state, svc, err)
+			return nil
+		})
+	}
+
+	// Errors from individual probes are recorded via recordProbeResult, not
+	// propagated, so a single slow/failing service can't cancel the tick for
+	// the rest of the cluster.
+	_ = g.Wait()
+}
+
+// recordProbeResult folds one probe outcome into state and, once a service
+// crosses cfg.ConsecutiveFailureThreshold, into cs's error count.
+func recordProbeResult(cs *ClusterState, cfg HealthCheckConfig, state *healthState, svc string, err error) {
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	threshold := cfg.ConsecutiveFailureThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	if err == nil {
+		wasunhealthy := state.consecutivefailures[svc] >= threshold
+		state.consecutivefailures[svc] = 0
+
+		if wasunhealthy {
+			cs.ResetError(svc)
+		}
+		return
+	}
+
+	state.consecutivefailures[svc]++
+
+	// A service that has never once succeeded (e.g. down since startup) is
+	// held to the same threshold as one that has, rather than being exempted
+	// indefinitely - a node that is down before first traffic is exactly the
+	// case active health checking exists to catch.
+	if state.consecutivefailures[svc] >= threshold {
+		cs.IncrementError(svc)
+	}
+}
+
+// jitterDuration returns a random duration in [-jitter, +jitter).
+func jitterDuration(jitter time.Duration) time.Duration {
+
+	if jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(2*jitter))) - jitter
+}
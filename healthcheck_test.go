@@ -0,0 +1,102 @@
+package harmonic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRecordProbeResultColdFailuresReachThreshold reproduces the chunk0-2
+// review scenario: a service that has never once succeeded must still be
+// marked unhealthy once it crosses ConsecutiveFailureThreshold, rather than
+// being exempted indefinitely by the old warm gate.
+func TestRecordProbeResultColdFailuresReachThreshold(t *testing.T) {
+
+	cs, err := InitClusterState([]string{"svcA", "svcB"})
+	if err != nil {
+		t.Fatalf("InitClusterState: %v", err)
+	}
+
+	cfg := HealthCheckConfig{ConsecutiveFailureThreshold: 2}
+	state := &healthState{consecutivefailures: make(map[string]int)}
+
+	probeErr := errors.New("probe failed")
+	for i := 0; i < 10; i++ {
+		recordProbeResult(cs, cfg, state, "svcA", probeErr)
+	}
+
+	count, err := cs.GetError("svcA")
+	if err != nil {
+		t.Fatalf("GetError: %v", err)
+	}
+	if count == 0 {
+		t.Fatalf("expected 10 consecutive cold failures (threshold 2) to mark svcA unhealthy, got error count 0")
+	}
+}
+
+// TestRecordProbeResultSuccessResetsAfterFailures verifies a service that
+// recovers after crossing the threshold has its error count reset.
+func TestRecordProbeResultSuccessResetsAfterFailures(t *testing.T) {
+
+	cs, err := InitClusterState([]string{"svcA", "svcB"})
+	if err != nil {
+		t.Fatalf("InitClusterState: %v", err)
+	}
+
+	cfg := HealthCheckConfig{ConsecutiveFailureThreshold: 2}
+	state := &healthState{consecutivefailures: make(map[string]int)}
+
+	probeErr := errors.New("probe failed")
+	recordProbeResult(cs, cfg, state, "svcA", probeErr)
+	recordProbeResult(cs, cfg, state, "svcA", probeErr)
+
+	if count, _ := cs.GetError("svcA"); count == 0 {
+		t.Fatalf("expected svcA to be unhealthy after 2 consecutive failures")
+	}
+
+	recordProbeResult(cs, cfg, state, "svcA", nil)
+
+	count, err := cs.GetError("svcA")
+	if err != nil {
+		t.Fatalf("GetError: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected a successful probe to reset svcA's error count, got %d", count)
+	}
+}
+
+// TestStartHealthChecksNonPositiveWaitDoesNotSpin guards against the
+// chunk0-2 review's second bug: an Interval/Jitter combination that would
+// otherwise yield a non-positive wait must still tick on a bounded cadence,
+// not busy-loop. It runs the checker briefly against a counting probe and
+// asserts the tick count stays sane rather than racing into the thousands.
+func TestStartHealthChecksNonPositiveWaitDoesNotSpin(t *testing.T) {
+
+	cs, err := InitClusterState([]string{"svcA"})
+	if err != nil {
+		t.Fatalf("InitClusterState: %v", err)
+	}
+
+	ticks := make(chan struct{}, 10000)
+	stop := cs.StartHealthChecks(HealthCheckConfig{
+		Probe: func(ctx context.Context, svc string) error {
+			select {
+			case ticks <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+		Interval: 0,
+		Jitter:   0,
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	stop()
+
+	// minTickWait floors each tick at 10ms, so 200ms should yield on the
+	// order of 20 ticks; a busy-loop would saturate into the thousands.
+	if n := len(ticks); n > 100 {
+		t.Fatalf("expected the health-check loop to be rate-limited by minTickWait, got %d ticks in 200ms", n)
+	}
+}
@@ -0,0 +1,87 @@
+package harmonic
+
+// SelectReason identifies which branch of SelectService (or
+// SelectServiceForKey) produced a given selection, so an Observer can
+// distinguish a steady-state pick from a retry or a degenerate case.
+type SelectReason int
+
+const (
+	// ReasonSingleEndpoint is used when the cluster has exactly one
+	// service, so no real selection takes place.
+	ReasonSingleEndpoint SelectReason = iota
+	// ReasonUniformRandom is used on a first try where no candidate service
+	// has recorded any errors, so every candidate is equally likely: plain
+	// random under StrategyRandom, the atomic cursor under StrategyAtomicRR
+	// and StrategyHybrid.
+	ReasonUniformRandom
+	// ReasonWeightedRandom is used on a first try where at least one
+	// candidate service has recorded errors, so selection is weighted by
+	// error count (walked by the atomic cursor under StrategyAtomicRR).
+	ReasonWeightedRandom
+	// ReasonRetryRoundRobin is used on a retry, where selection deterministically
+	// advances to the next candidate.
+	ReasonRetryRoundRobin
+	// ReasonRendezvousHash is used by SelectServiceForKey on a first try,
+	// where selection is the highest-scoring service under rendezvous (HRW)
+	// hashing of the caller-supplied key.
+	ReasonRendezvousHash
+	// ReasonRendezvousRetry is used by SelectServiceForKey on a retry, where
+	// selection deterministically advances to the next-highest scoring
+	// service for the same key.
+	ReasonRendezvousRetry
+	// ReasonHalfOpenProbe is used on a first try where an ejected service's
+	// backoff has expired and it has been force-selected for its single
+	// half-open probe request, ahead of the normal weighted/rendezvous pick.
+	ReasonHalfOpenProbe
+)
+
+// String returns a short, stable label suitable for metric dimensions.
+func (r SelectReason) String() string {
+	switch r {
+	case ReasonSingleEndpoint:
+		return "single_endpoint"
+	case ReasonUniformRandom:
+		return "uniform_random"
+	case ReasonWeightedRandom:
+		return "weighted_random"
+	case ReasonRetryRoundRobin:
+		return "retry_round_robin"
+	case ReasonRendezvousHash:
+		return "rendezvous_hash"
+	case ReasonRendezvousRetry:
+		return "rendezvous_retry"
+	case ReasonHalfOpenProbe:
+		return "half_open_probe"
+	default:
+		return "unknown"
+	}
+}
+
+// Observer receives callbacks at each decision point of SelectService,
+// IncrementError and ResetError, so callers can wire up metrics, tracing or
+// logging without forking the selection code. All methods must be safe for
+// concurrent use, since SelectService may be called from many goroutines.
+type Observer interface {
+	// OnSelect is called whenever a service is chosen, on both first try and
+	// retry. weights is the per-candidate weight vector used for the
+	// decision; it is nil for every reason other than ReasonWeightedRandom.
+	OnSelect(svc string, reason SelectReason, weights []float64)
+	// OnRetry is called before a retry selection is made, identifying the
+	// service that failed (prev), the one about to be tried (next) and the
+	// retry attempt number.
+	OnRetry(prev string, next string, attempt int)
+	// OnErrorIncrement is called after a service's error count is incremented,
+	// with the resulting count.
+	OnErrorIncrement(svc string, count uint64)
+	// OnReset is called after a service's error count is reset to zero.
+	OnReset(svc string)
+}
+
+// NoopObserver is the default Observer installed by InitClusterState. All
+// methods are no-ops.
+type NoopObserver struct{}
+
+func (NoopObserver) OnSelect(svc string, reason SelectReason, weights []float64) {}
+func (NoopObserver) OnRetry(prev string, next string, attempt int)               {}
+func (NoopObserver) OnErrorIncrement(svc string, count uint64)                   {}
+func (NoopObserver) OnReset(svc string)                                          {}
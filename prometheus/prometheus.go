@@ -0,0 +1,61 @@
+// Package prometheus provides a harmonic.Observer that exposes
+// out-of-the-box Prometheus metrics for the weighted routing decisions made
+// by harmonic.SelectService.
+package prometheus
+
+import (
+	"github.com/gptankit/harmonic"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusObserver is a harmonic.Observer that records selection and
+// error counters/gauges:
+//
+//	harmonic_service_selected_total{service,reason} - counter, incremented on every selection
+//	harmonic_service_errors{service}                - gauge, set to the service's current error count
+//
+// Construct one with NewPrometheusObserver and assign it to
+// ClusterState.Observer.
+type PrometheusObserver struct {
+	selected *prometheus.CounterVec
+	errors   *prometheus.GaugeVec
+}
+
+// NewPrometheusObserver creates a PrometheusObserver and registers its
+// metrics against reg. Pass prometheus.DefaultRegisterer to use the global
+// registry.
+func NewPrometheusObserver(reg prometheus.Registerer) *PrometheusObserver {
+
+	selected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "harmonic_service_selected_total",
+		Help: "Total number of times a service was selected by SelectService, by reason.",
+	}, []string{"service", "reason"})
+
+	errors := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "harmonic_service_errors",
+		Help: "Current error count tracked against a service by ClusterState.",
+	}, []string{"service"})
+
+	reg.MustRegister(selected, errors)
+
+	return &PrometheusObserver{selected: selected, errors: errors}
+}
+
+// OnSelect implements harmonic.Observer.
+func (p *PrometheusObserver) OnSelect(svc string, reason harmonic.SelectReason, weights []float64) {
+	p.selected.WithLabelValues(svc, reason.String()).Inc()
+}
+
+// OnRetry implements harmonic.Observer. Retries are already reflected in the
+// next OnSelect call's reason, so this is a no-op.
+func (p *PrometheusObserver) OnRetry(prev string, next string, attempt int) {}
+
+// OnErrorIncrement implements harmonic.Observer.
+func (p *PrometheusObserver) OnErrorIncrement(svc string, count uint64) {
+	p.errors.WithLabelValues(svc).Set(float64(count))
+}
+
+// OnReset implements harmonic.Observer.
+func (p *PrometheusObserver) OnReset(svc string) {
+	p.errors.WithLabelValues(svc).Set(0)
+}
@@ -0,0 +1,21 @@
+package harmonic
+
+import (
+	"math/rand"
+)
+
+// randomize returns a random int in [min, max).
+func randomize(min int, max int) int {
+	return min + rand.Intn(max-min)
+}
+
+// randomize64 returns a random int64 in [min, max).
+func randomize64(min int64, max int64) int64 {
+	return min + rand.Int63n(max-min)
+}
+
+// roundrobin returns the index following prevserviceindex, wrapping
+// around to 0 once the end of the servicelist is reached.
+func roundrobin(numservices int, prevserviceindex int) int {
+	return (prevserviceindex + 1) % numservices
+}
@@ -0,0 +1,134 @@
+package harmonic
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// SelectionMode names the algorithm a ClusterState is routed with on the
+// first try of a request. SelectService refuses ModeRendezvousHash;
+// SelectServiceForKey does not check the mode.
+type SelectionMode int
+
+const (
+	// ModeWeightedRandom is the default mode, used by SelectService. It
+	// picks services at random, weighted inversely by error count.
+	ModeWeightedRandom SelectionMode = iota
+	// ModeRendezvousHash is used by SelectServiceForKey. It deterministically
+	// maps a caller-supplied key to a service via rendezvous (HRW) hashing,
+	// so the same key always routes to the same service as long as the
+	// cluster and error counts are unchanged.
+	ModeRendezvousHash
+)
+
+// fnv1a64 is the default Hash64 implementation used by ClusterState when one
+// is not supplied by the caller. Callers that want a faster or better
+// distributed hash (e.g. xxhash) can override ClusterState.Hash64.
+func fnv1a64(s string) uint64 {
+
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// SelectServiceForKey implements keyed sticky selection: the same key will
+// consistently route to the same service (rendezvous/HRW hashing) as long as
+// the cluster membership and relative error counts don't change, giving
+// per-tenant/per-object routing analogous to a `?choose=<n>|<key>` query
+// parameter. On first try, the service with the highest rendezvous score
+//
+//	score(svc) = Hash64(svc+key) / (1+errcnt(svc))^1.5
+//
+// is chosen, so the existing error-weight decay still biases away from
+// unhealthy services. On retry, selection deterministically advances to the
+// next-highest scoring service instead of plain round robin, keeping retries
+// key-stable across the cluster. Adding or removing a single service only
+// reshuffles the keys that hashed nearest to it, roughly 1/N of all keys.
+func SelectServiceForKey(cs *ClusterState, key string, retryindex int, prevservice string) (string, error) {
+
+	if cs.numservices == 0 {
+		return "", errors.New("harmonic: servicelist is empty")
+	}
+
+	if cs.numservices == 1 {
+		svc, err := getIndexedService(cs, 0)
+		return cs.observeSelect(svc, err, ReasonSingleEndpoint, nil)
+	}
+
+	if retryindex == 0 { // first try
+		if svc, ok := cs.forcedHalfOpenProbe(); ok {
+			return cs.observeSelect(svc, nil, ReasonHalfOpenProbe, nil)
+		}
+	}
+
+	ranked := cs.rankServicesForKey(key)
+
+	if retryindex == 0 { // first try
+		return cs.observeSelect(ranked[0], nil, ReasonRendezvousHash, nil)
+	}
+
+	// retries: advance to the next-highest scoring service after prevservice
+	prevrank := -1
+	for i, svc := range ranked {
+		if svc == prevservice {
+			prevrank = i
+			break
+		}
+	}
+
+	next := ranked[0]
+	if prevrank != -1 {
+		next = ranked[(prevrank+1)%len(ranked)]
+	}
+
+	cs.observer().OnRetry(prevservice, next, retryindex)
+	return cs.observeSelect(next, nil, ReasonRendezvousRetry, nil)
+}
+
+// rankServicesForKey returns every eligible (non-ejected) service in cs,
+// ordered by descending rendezvous score for key. Ties (possible when
+// errcnt is equal and hashes collide) are broken by service name so the
+// ordering is fully deterministic.
+func (cs *ClusterState) rankServicesForKey(key string) []string {
+
+	candidates := cs.eligibleServices()
+	if len(candidates) == 0 {
+		candidates = cs.servicelist
+	}
+
+	cs.remutex.RLock()
+	defer cs.remutex.RUnlock()
+
+	hash64 := cs.Hash64
+	if hash64 == nil {
+		hash64 = fnv1a64
+	}
+
+	type scored struct {
+		svc   string
+		score float64
+	}
+
+	scores := make([]scored, len(candidates))
+	for i, svc := range candidates {
+		errcnt := cs.errormap[svc]
+		decay := math.Pow(float64(1+errcnt), 1.5)
+		scores[i] = scored{svc: svc, score: float64(hash64(svc+key)) / decay}
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		return scores[i].svc < scores[j].svc
+	})
+
+	ranked := make([]string, len(candidates))
+	for i, s := range scores {
+		ranked[i] = s.svc
+	}
+
+	return ranked
+}
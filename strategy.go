@@ -0,0 +1,62 @@
+package harmonic
+
+// SelectionStrategy controls how SelectService picks a starting point among
+// equally-eligible candidates on the first try, independent of the
+// weighting already applied via error counts.
+type SelectionStrategy int
+
+const (
+	// StrategyRandom draws a fresh math/rand value on every call, exactly as
+	// SelectService always has. This remains the default for backward
+	// compatibility.
+	StrategyRandom SelectionStrategy = iota
+	// StrategyAtomicRR replaces randomness with a shared, atomically
+	// incremented cursor (ClusterState.startIndex) for both the no-error
+	// uniform pick and the weighted prefix-sum search: instead of drawing a
+	// fresh random value in [1, totalWeight] on every call, it walks that
+	// range deterministically one step at a time, so a full cycle of
+	// totalWeight calls visits every unit of weight - and hence every
+	// candidate, in proportion to its weight - exactly once. This spreads a
+	// burst of concurrent first-try requests evenly across all candidates
+	// instead of relying on RNG variance, avoiding the thundering-herd
+	// clumping that per-request rand seeding can produce under high
+	// concurrency.
+	StrategyAtomicRR
+	// StrategyHybrid uses the atomic cursor only for the no-error uniform
+	// pick (where fairness matters most, since every candidate is otherwise
+	// indistinguishable) and leaves weighted selection under real error
+	// pressure as plain weighted random.
+	StrategyHybrid
+)
+
+// nextStartIndex atomically advances cs.startIndex and returns its new
+// value modulo n, so concurrent callers are handed out consecutive,
+// non-overlapping starting points.
+func (cs *ClusterState) nextStartIndex(n int) int {
+
+	next := int(cs.startIndex.Add(1))
+	idx := next % n
+	if idx < 0 {
+		idx += n
+	}
+
+	return idx
+}
+
+// nextWeightedPos atomically advances cs.startIndex and maps it into
+// [1, total], deterministically walking the weighted prefix-sum space (see
+// StrategyAtomicRR) instead of drawing a fresh random value.
+func (cs *ClusterState) nextWeightedPos(total int64) int64 {
+
+	if total <= 0 {
+		return 1
+	}
+
+	cursor := int64(cs.startIndex.Add(1))
+	pos := cursor % total
+	if pos < 0 {
+		pos += total
+	}
+
+	return pos + 1
+}
@@ -0,0 +1,185 @@
+package harmonic
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// TieredClusterState routes across ordered groups of services — e.g. a
+// primary AZ, a secondary AZ, a cross-region fallback — where each group is
+// its own ClusterState (with its own weighting, ejection and health-check
+// state) and the router only advances to the next group once every service
+// in the current group has been tried and failed, or the group's aggregate
+// health has dropped below HealthThreshold. Within a group, selection and
+// retries behave exactly like a plain ClusterState.
+type TieredClusterState struct {
+	groups       []*ClusterState
+	servicegroup map[string]int
+
+	// startGroupIndex is the currently sticky group. It advances (wrapping
+	// modulo len(groups)) past a group that is exhausted or unhealthy, and
+	// preferHealthiestGroup moves it back to a lower-indexed group that is
+	// healthy on a fresh request; otherwise a group stays in use across
+	// requests, to avoid constant cross-tier bouncing. It is shared, mutable state advanced by
+	// every concurrent caller's retry walk (and by preferHealthiestGroup), so
+	// under concurrent requests against an unhealthy group the sticky
+	// promise is only best-effort: the index can advance by more than one
+	// group within a single request's retry sequence if other requests are
+	// advancing it at the same time, rather than settling deterministically.
+	startGroupIndex atomic.Int32
+
+	// HealthThreshold is the minimum fraction (0.0-1.0) of error-free
+	// services a group must have to be considered usable. A group falling
+	// below this is skipped even if it still has untried services. Zero
+	// disables the health check (a group is only skipped once exhausted).
+	HealthThreshold float64
+}
+
+// InitTieredClusterState initializes a TieredClusterState from an ordered
+// list of groups, each a flat list of service endpoints. Groups are tried
+// in the given order. An error is returned if there are no groups, any
+// group is empty, or a service name appears in more than one group.
+func InitTieredClusterState(groups [][]string) (*TieredClusterState, error) {
+
+	if len(groups) == 0 {
+		return nil, errors.New("harmonic: no groups provided")
+	}
+
+	tcs := &TieredClusterState{
+		groups:       make([]*ClusterState, len(groups)),
+		servicegroup: make(map[string]int),
+	}
+
+	for gi, servicelist := range groups {
+		cs, err := InitClusterState(servicelist)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, svc := range servicelist {
+			if _, dup := tcs.servicegroup[svc]; dup {
+				return nil, errors.New("harmonic: service " + svc + " appears in more than one group")
+			}
+			tcs.servicegroup[svc] = gi
+		}
+
+		tcs.groups[gi] = cs
+	}
+
+	return tcs, nil
+}
+
+// SelectService performs weighted selection within the first group (starting
+// from the sticky startGroupIndex) whose aggregate health is above
+// HealthThreshold. Only once every service in that group has been tried
+// during retries (or its health has dropped) does selection advance to the
+// next group, restarting retryindex from 0. On a fresh request (retryindex
+// 0), a lower-indexed (higher-priority) group that has recovered is
+// preferred back over the currently sticky one, so the cluster fails back
+// once a primary group's health returns; an in-flight retry sequence
+// (retryindex > 0) never has its group changed out from under it this way.
+func (tcs *TieredClusterState) SelectService(retryindex int, prevservice string) (string, error) {
+
+	if retryindex == 0 {
+		tcs.preferHealthiestGroup()
+	}
+
+	for attempts := 0; attempts < len(tcs.groups); attempts++ {
+
+		raw := tcs.startGroupIndex.Load()
+		gi := normalizeGroupIndex(raw, len(tcs.groups))
+		group := tcs.groups[gi]
+
+		if retryindex < group.numservices && groupIsHealthy(group, tcs.HealthThreshold) {
+			return SelectService(group, retryindex, prevservice)
+		}
+
+		// Advance the shared sticky index past this exhausted/unhealthy
+		// group, but only from the raw value this call actually observed:
+		// if another concurrent request already advanced past gi, this CAS
+		// simply fails and the loop re-reads the newer index instead of
+		// bumping it again, so the sticky group doesn't race arbitrarily far
+		// ahead under concurrent retries. Stickiness is still only
+		// best-effort across concurrent requests - see startGroupIndex.
+		tcs.startGroupIndex.CompareAndSwap(raw, raw+1)
+		retryindex = 0
+		prevservice = ""
+	}
+
+	return "", errors.New("harmonic: all groups exhausted")
+}
+
+// currentGroupIndex returns the sticky group index modulo len(tcs.groups),
+// guarding against a negative result once startGroupIndex wraps past
+// math.MaxInt32.
+func (tcs *TieredClusterState) currentGroupIndex() int {
+
+	return normalizeGroupIndex(tcs.startGroupIndex.Load(), len(tcs.groups))
+}
+
+// normalizeGroupIndex reduces a raw startGroupIndex value modulo n, guarding
+// against a negative result once the counter wraps past math.MaxInt32.
+func normalizeGroupIndex(raw int32, n int) int {
+
+	idx := int(raw) % n
+	if idx < 0 {
+		idx += n
+	}
+
+	return idx
+}
+
+// preferHealthiestGroup fails a fresh request back to the lowest-indexed
+// healthy group, so a higher-priority group that has recovered is used
+// again instead of staying pinned to whatever group most recently absorbed
+// a failure.
+func (tcs *TieredClusterState) preferHealthiestGroup() {
+
+	current := tcs.currentGroupIndex()
+
+	for gi := 0; gi < current; gi++ {
+		if groupIsHealthy(tcs.groups[gi], tcs.HealthThreshold) {
+			tcs.startGroupIndex.Store(int32(gi))
+			return
+		}
+	}
+}
+
+// IncrementError increments the error count for svc in whichever group it
+// belongs to.
+func (tcs *TieredClusterState) IncrementError(svc string) {
+
+	if gi, ok := tcs.servicegroup[svc]; ok {
+		tcs.groups[gi].IncrementError(svc)
+	}
+}
+
+// ResetError resets the error count for svc in whichever group it belongs
+// to.
+func (tcs *TieredClusterState) ResetError(svc string) {
+
+	if gi, ok := tcs.servicegroup[svc]; ok {
+		tcs.groups[gi].ResetError(svc)
+	}
+}
+
+// groupIsHealthy reports whether the fraction of error-free services in
+// group meets threshold. threshold <= 0 disables the check.
+func groupIsHealthy(group *ClusterState, threshold float64) bool {
+
+	if threshold <= 0 {
+		return true
+	}
+
+	group.remutex.RLock()
+	defer group.remutex.RUnlock()
+
+	healthy := 0
+	for _, svc := range group.servicelist {
+		if group.errormap[svc] == 0 {
+			healthy++
+		}
+	}
+
+	return float64(healthy)/float64(group.numservices) >= threshold
+}